@@ -2,14 +2,24 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"go/build/constraint"
+	"hash/fnv"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
+	"golang.org/x/sync/errgroup"
 	"gopkg.in/yaml.v3"
 )
 
@@ -17,6 +27,52 @@ import (
 type Config struct {
 	ExcludeFolders []string `yaml:"ExcludeFolders"`
 	ExcludeFiles   []string `yaml:"ExcludeFiles"`
+
+	// Exclude holds gitignore-style patterns evaluated in addition to
+	// ExcludeFolders/ExcludeFiles, which are kept for back-compat.
+	Exclude []string `yaml:"Exclude,omitempty"`
+	// Include is an allowlist of gitignore-style patterns evaluated after
+	// Exclude, re-including any path that the exclude patterns match. Files
+	// beneath an excluded directory are never walked, so Include re-includes
+	// them only if it matches that directory itself.
+	Include []string `yaml:"Include,omitempty"`
+
+	// BuildTags, GOOS and GOARCH describe the target environment used to
+	// filter .go files by their build constraints. Left empty, no
+	// constraint-based filtering is applied.
+	BuildTags []string `yaml:"BuildTags,omitempty"`
+	GOOS      string   `yaml:"GOOS,omitempty"`
+	GOARCH    string   `yaml:"GOARCH,omitempty"`
+}
+
+// ManifestEntry records where one file's rendered chunk landed in an output
+// file, plus the content hash used for dedup and incremental reuse. IsDup
+// and DupOf mark an entry whose chunk is a "(dup of ...)" stub rather than
+// full content, so -incremental never mistakes a stub for the real thing.
+type ManifestEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256"`
+	ModTime time.Time `json:"mod_time"`
+	Offset  int64     `json:"offset"`
+	Length  int64     `json:"length"`
+	IsDup   bool      `json:"is_dup,omitempty"`
+	DupOf   string    `json:"dup_of,omitempty"`
+}
+
+// Manifest is the sidecar written next to an output file (as
+// "<output>.manifest.json") so a later -incremental run can tell which
+// files are unchanged.
+type Manifest struct {
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// ShardIndex is "code.index.yml", written alongside sharded output. Each
+// -shard/-shards run updates its own entry, keyed by shard number as a
+// string, so the file accumulates the full path->shard mapping across runs.
+type ShardIndex struct {
+	Shards      int                 `yaml:"shards"`
+	Assignments map[string][]string `yaml:"assignments"`
 }
 
 // Log message formatting
@@ -48,6 +104,108 @@ func writeConfig(configPath string, config Config) error {
 	return ioutil.WriteFile(configPath, data, 0644)
 }
 
+// manifestPath returns the sidecar manifest path for a given output file.
+func manifestPath(outputPath string) string {
+	return outputPath + ".manifest.json"
+}
+
+// loadManifest reads the sidecar manifest for outputPath, if one exists.
+func loadManifest(outputPath string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(manifestPath(outputPath))
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// writeManifest persists manifest as the sidecar for outputPath.
+func writeManifest(outputPath string, manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(manifestPath(outputPath), data, 0644)
+}
+
+// manifestByPath indexes a manifest's entries by path for incremental lookups.
+func manifestByPath(manifest *Manifest) map[string]ManifestEntry {
+	if manifest == nil {
+		return nil
+	}
+	byPath := make(map[string]ManifestEntry, len(manifest.Entries))
+	for _, entry := range manifest.Entries {
+		byPath[entry.Path] = entry
+	}
+	return byPath
+}
+
+// hashBytes returns the hex-encoded SHA-256 digest of data.
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// shardIndexPath returns the top-level shard index path for a sharded
+// outputPath, e.g. "out/code.txt.shard-0-of-4" -> "out/code.index.yml".
+func shardIndexPath(outputPath string) string {
+	return filepath.Join(filepath.Dir(outputPath), "code.index.yml")
+}
+
+// loadShardIndex reads the existing shard index next to outputPath, if any.
+// If it was built under a different -shards total, its assignments were
+// computed from a different hash-mod-shards split and no longer describe
+// any shard of the current run, so they're dropped rather than merged with.
+func loadShardIndex(outputPath string, shards int) ShardIndex {
+	idx := ShardIndex{Assignments: make(map[string][]string)}
+	data, err := ioutil.ReadFile(shardIndexPath(outputPath))
+	if err != nil {
+		return idx
+	}
+	if err := yaml.Unmarshal(data, &idx); err != nil {
+		return ShardIndex{Assignments: make(map[string][]string)}
+	}
+	if idx.Assignments == nil {
+		idx.Assignments = make(map[string][]string)
+	}
+	if idx.Shards != shards {
+		idx.Assignments = make(map[string][]string)
+	}
+	return idx
+}
+
+// writeShardIndex persists idx as the shard index next to outputPath.
+func writeShardIndex(outputPath string, idx ShardIndex) error {
+	data, err := yaml.Marshal(&idx)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(shardIndexPath(outputPath), data, 0644)
+}
+
+// fnv1aHash returns the FNV-1a hash of s, used to deterministically assign
+// files to shards.
+func fnv1aHash(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+// filterShard keeps only the files whose path hashes into the given shard,
+// out of shards total.
+func filterShard(files []fileEntry, shard, shards int) []fileEntry {
+	var out []fileEntry
+	for _, f := range files {
+		if int(fnv1aHash(f.path)%uint32(shards)) == shard {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
 // Function to detect project type and generate codex.yml
 func detectProjectType(path string) string {
 	if _, err := os.Stat(filepath.Join(path, "package.json")); err == nil {
@@ -101,14 +259,464 @@ func generateCodexYml(path string, projectType string) Config {
 	return config
 }
 
-// Function to check if a file or folder should be excluded
-func shouldExclude(path string, excludes []string) bool {
-	for _, exclude := range excludes {
-		if strings.Contains(path, exclude) {
+// matchSegments matches path segments against pattern segments, where a "**"
+// pattern segment matches zero or more path segments (gitignore's any-depth
+// wildcard) and every other segment is matched via path.Match.
+func matchSegments(patternSegs, pathSegs []string) bool {
+	if len(patternSegs) == 0 {
+		return len(pathSegs) == 0
+	}
+
+	if patternSegs[0] == "**" {
+		if len(patternSegs) == 1 {
+			return true
+		}
+		for i := 0; i <= len(pathSegs); i++ {
+			if matchSegments(patternSegs[1:], pathSegs[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(pathSegs) == 0 {
+		return false
+	}
+	if ok, err := path.Match(patternSegs[0], pathSegs[0]); err != nil || !ok {
+		return false
+	}
+	return matchSegments(patternSegs[1:], pathSegs[1:])
+}
+
+// gitignoreMatch reports whether relPath (slash-separated, relative to the
+// walk root) matches a single gitignore-style pattern: "**" for any-depth
+// directories, "*"/"?" character classes via path.Match, a leading "/" to
+// anchor the pattern to the root, and a trailing "/" to match directories
+// only. Negation ("!") is handled by the caller.
+func gitignoreMatch(pattern string, relPath string, isDir bool) bool {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if dirOnly && !isDir {
+		return false
+	}
+
+	anchored := strings.HasPrefix(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	patternSegs := strings.Split(pattern, "/")
+	if len(patternSegs) > 1 {
+		// A slash anywhere but the end anchors the pattern to the root,
+		// whether or not it also had a leading slash.
+		anchored = true
+	}
+	if !anchored {
+		patternSegs = append([]string{"**"}, patternSegs...)
+	}
+
+	pathSegs := strings.Split(relPath, "/")
+	return matchSegments(patternSegs, pathSegs)
+}
+
+// collectExcludePatterns merges the legacy ExcludeFolders/ExcludeFiles
+// fields with the unified Exclude list, preserving order so later patterns
+// (including "!" negations) can override earlier ones as in .gitignore.
+func collectExcludePatterns(config Config) []string {
+	var patterns []string
+	patterns = append(patterns, config.ExcludeFolders...)
+	patterns = append(patterns, config.ExcludeFiles...)
+	patterns = append(patterns, config.Exclude...)
+	return patterns
+}
+
+// isExcluded reports whether relPath should be skipped, by evaluating the
+// merged exclude patterns in order (later patterns win, "!" re-includes),
+// then checking the Include allowlist as a final override.
+func isExcluded(relPath string, isDir bool, config Config) bool {
+	excluded := false
+	for _, pattern := range collectExcludePatterns(config) {
+		negate := strings.HasPrefix(pattern, "!")
+		if negate {
+			pattern = pattern[1:]
+		}
+		if gitignoreMatch(pattern, relPath, isDir) {
+			excluded = !negate
+		}
+	}
+
+	if excluded {
+		for _, pattern := range config.Include {
+			if gitignoreMatch(pattern, relPath, isDir) {
+				return false
+			}
+		}
+	}
+
+	return excluded
+}
+
+// importGitignore reads dir's .gitignore, if any, and returns its patterns
+// (blank lines and comments stripped) for seeding a codex.yml's Exclude list.
+func importGitignore(dir string) []string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// fileEntry is a walked file awaiting processing.
+type fileEntry struct {
+	path string
+	info os.FileInfo
+}
+
+// knownGOOS and knownGOARCH list the filename suffixes Go's own build system
+// recognizes (see "go help buildconstraint"), used to honor conventions like
+// foo_linux.go or foo_amd64_test.go without requiring a //go:build comment.
+var knownGOOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true,
+	"freebsd": true, "illumos": true, "ios": true, "js": true,
+	"linux": true, "netbsd": true, "openbsd": true, "plan9": true,
+	"solaris": true, "wasip1": true, "windows": true,
+}
+
+var knownGOARCH = map[string]bool{
+	"386": true, "amd64": true, "arm": true, "arm64": true,
+	"mips": true, "mipsle": true, "mips64": true, "mips64le": true,
+	"ppc64": true, "ppc64le": true, "riscv64": true, "s390x": true,
+	"wasm": true,
+}
+
+// matchesFilenameConstraints applies Go's _GOOS.go / _GOARCH.go /
+// _GOOS_GOARCH.go filename convention (also honoring a trailing _test), so a
+// file is excluded if its name names an OS or arch other than the
+// configured one.
+func matchesFilenameConstraints(goPath string, config Config) bool {
+	name := strings.TrimSuffix(filepath.Base(goPath), ".go")
+	name = strings.TrimSuffix(name, "_test")
+
+	parts := strings.Split(name, "_")
+	if len(parts) < 2 {
+		return true
+	}
+
+	last := parts[len(parts)-1]
+	if knownGOARCH[last] {
+		if config.GOARCH != "" && last != config.GOARCH {
+			return false
+		}
+		if len(parts) >= 3 && knownGOOS[parts[len(parts)-2]] {
+			if config.GOOS != "" && parts[len(parts)-2] != config.GOOS {
+				return false
+			}
+		}
+		return true
+	}
+
+	if knownGOOS[last] {
+		return config.GOOS == "" || last == config.GOOS
+	}
+
+	return true
+}
+
+// parseBuildConstraint reads goPath's leading comment lines and returns the
+// combined //go:build (or // +build) expression, if any.
+func parseBuildConstraint(goPath string) (constraint.Expr, error) {
+	f, err := os.Open(goPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var expr constraint.Expr
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "//") {
+			break
+		}
+
+		if constraint.IsGoBuild(line) || constraint.IsPlusBuild(line) {
+			parsed, err := constraint.Parse(line)
+			if err != nil {
+				continue
+			}
+			if expr == nil {
+				expr = parsed
+			} else {
+				expr = &constraint.AndExpr{X: expr, Y: parsed}
+			}
+		}
+	}
+	return expr, scanner.Err()
+}
+
+// matchesGoEnvironment reports whether goPath would be compiled for the
+// configured GOOS/GOARCH/BuildTags, per its filename and //go:build
+// constraints. Filtering is a no-op unless at least one of those three
+// fields is configured.
+func matchesGoEnvironment(goPath string, config Config) bool {
+	if config.GOOS == "" && config.GOARCH == "" && len(config.BuildTags) == 0 {
+		return true
+	}
+	if !strings.HasSuffix(goPath, ".go") {
+		return true
+	}
+
+	if !matchesFilenameConstraints(goPath, config) {
+		return false
+	}
+
+	expr, err := parseBuildConstraint(goPath)
+	if err != nil || expr == nil {
+		return true
+	}
+
+	satisfied := func(tag string) bool {
+		if tag == config.GOOS || tag == config.GOARCH {
 			return true
 		}
+		for _, t := range config.BuildTags {
+			if t == tag {
+				return true
+			}
+		}
+		return false
 	}
-	return false
+	return expr.Eval(satisfied)
+}
+
+// collectFiles walks dir applying the exclusion rules from config and returns
+// the files to process, in filepath.Walk order.
+func collectFiles(dir string, config Config) ([]fileEntry, error) {
+	var files []fileEntry
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			logMessage("ERROR", fmt.Sprintf("Error accessing path %s: %s", p, err))
+			return err
+		}
+
+		relPath, relErr := filepath.Rel(dir, p)
+		if relErr != nil {
+			relPath = p
+		}
+		relPath = filepath.ToSlash(relPath)
+		if relPath == "." {
+			return nil
+		}
+
+		if info.IsDir() {
+			if isExcluded(relPath, true, config) {
+				logMessage("INFO", fmt.Sprintf("Skipping folder: %s", p))
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if isExcluded(relPath, false, config) {
+			logMessage("INFO", fmt.Sprintf("Skipping file: %s", p))
+			return nil
+		}
+
+		if !matchesGoEnvironment(p, config) {
+			logMessage("INFO", fmt.Sprintf("Skipping file (build constraints): %s", p))
+			return nil
+		}
+
+		files = append(files, fileEntry{path: p, info: info})
+		return nil
+	})
+	return files, err
+}
+
+// fileResult is one file's read-and-hash outcome. content is nil when reused
+// is true, since the bytes were not re-read from disk.
+type fileResult struct {
+	path    string
+	size    int64
+	modTime time.Time
+	sha256  string
+	content []byte
+	reused  bool
+}
+
+// readAndHashFile reads path and hashes its contents, unless prior describes
+// the same size and mtime, in which case its hash is trusted and the read is
+// skipped entirely — the point of -incremental. A prior entry that was
+// itself a dedup stub is never reused: its recorded bytes aren't the file's
+// real content, so reuse would keep re-emitting the stub indefinitely even
+// after the file becomes the only (or first) copy of its content.
+func readAndHashFile(path string, info os.FileInfo, prior *ManifestEntry) (fileResult, error) {
+	if prior != nil && !prior.IsDup && prior.Size == info.Size() && prior.ModTime.Equal(info.ModTime()) {
+		return fileResult{path: path, size: info.Size(), modTime: info.ModTime(), sha256: prior.SHA256, reused: true}, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fileResult{}, err
+	}
+	return fileResult{path: path, size: info.Size(), modTime: info.ModTime(), sha256: hashBytes(content), content: content}, nil
+}
+
+// processFilesParallel reads and hashes files through a bounded worker pool
+// of size jobs. On the first error, the shared context is cancelled so
+// in-flight goroutines skip their read and no new ones are dispatched.
+// priorByPath enables -incremental reuse and may be nil. The returned slice
+// preserves the order of files so the caller can assemble output
+// deterministically.
+func processFilesParallel(files []fileEntry, jobs int, priorByPath map[string]ManifestEntry) ([]fileResult, error) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	results := make([]fileResult, len(files))
+	g, ctx := errgroup.WithContext(context.Background())
+	sem := make(chan struct{}, jobs)
+
+	for i, f := range files {
+		i, f := i, f
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		sem <- struct{}{}
+		g.Go(func() error {
+			defer func() { <-sem }()
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			var prior *ManifestEntry
+			if entry, ok := priorByPath[f.path]; ok {
+				prior = &entry
+			}
+
+			logMessage("INFO", fmt.Sprintf("Processing file: %s", f.path))
+			result, err := readAndHashFile(f.path, f.info, prior)
+			if err != nil {
+				logMessage("ERROR", fmt.Sprintf("Failed to read file: %s", err))
+				return err
+			}
+			results[i] = result
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// renderChunk formats a file's entry the way it appears in the output file.
+// When dupOf is non-nil, a short reference is written instead of the content.
+func renderChunk(path string, content []byte, dupOf *string) []byte {
+	var buf bytes.Buffer
+	if dupOf != nil {
+		buf.WriteString(fmt.Sprintf("##### %s (dup of %s) #####\n\n", path, *dupOf))
+		return buf.Bytes()
+	}
+
+	buf.WriteString(fmt.Sprintf("##### %s #####\n\n", path))
+	buf.Write(content)
+	buf.WriteString("\n\n")
+	return buf.Bytes()
+}
+
+// assembleOutput writes each result's chunk to writer in order and builds
+// the manifest describing where it landed. Results flagged reused have their
+// chunk copied byte-for-byte from priorOutput instead of being re-rendered,
+// unless dedup is set and their hash was already emitted;
+// when dedup is set, later files whose hash repeats an earlier one get a
+// short "(dup of ...)" reference instead of their full content.
+func assembleOutput(writer *bufio.Writer, results []fileResult, priorOutput []byte, priorByPath map[string]ManifestEntry, dedup bool) (Manifest, error) {
+	var manifest Manifest
+	seenHash := make(map[string]string)
+	var offset int64
+
+	for _, r := range results {
+		var chunk []byte
+		var isDup bool
+		var dupOfPath string
+
+		if r.reused {
+			// With dedup on, a reused file whose hash was already emitted
+			// is re-rendered below as a dup reference, not copied in full.
+			_, alreadySeen := seenHash[r.sha256]
+			if prior, ok := priorByPath[r.path]; ok && !(dedup && alreadySeen) && prior.Offset >= 0 && prior.Offset+prior.Length <= int64(len(priorOutput)) {
+				chunk = append([]byte(nil), priorOutput[prior.Offset:prior.Offset+prior.Length]...)
+				if _, ok := seenHash[r.sha256]; !ok {
+					seenHash[r.sha256] = r.path
+				}
+			}
+		}
+
+		if chunk == nil {
+			content := r.content
+			if content == nil {
+				// The file was marked reused but its prior chunk was not
+				// copied: either the previous output no longer has the
+				// promised byte range (e.g. it was truncated or the manifest
+				// is stale) or dedup needs a dup reference in its place —
+				// fall back to a fresh read rather than silently emitting an
+				// empty chunk.
+				data, err := ioutil.ReadFile(r.path)
+				if err != nil {
+					return manifest, err
+				}
+				content = data
+				r.sha256 = hashBytes(content)
+			}
+
+			var dupOf *string
+			if dedup {
+				if first, ok := seenHash[r.sha256]; ok {
+					dupOf = &first
+				} else {
+					seenHash[r.sha256] = r.path
+				}
+			}
+			if dupOf != nil {
+				isDup = true
+				dupOfPath = *dupOf
+			}
+			chunk = renderChunk(r.path, content, dupOf)
+		}
+
+		n, err := writer.Write(chunk)
+		if err != nil {
+			return manifest, err
+		}
+
+		manifest.Entries = append(manifest.Entries, ManifestEntry{
+			Path:    r.path,
+			Size:    r.size,
+			SHA256:  r.sha256,
+			ModTime: r.modTime,
+			Offset:  offset,
+			Length:  int64(n),
+			IsDup:   isDup,
+			DupOf:   dupOfPath,
+		})
+		offset += int64(n)
+	}
+
+	return manifest, nil
 }
 
 func main() {
@@ -118,6 +726,11 @@ func main() {
 
 	// Flags for the 'run' command
 	outputPath := runCmd.String("output", "code.txt", "Path to the output file")
+	jobs := runCmd.Int("n", runtime.NumCPU(), "Number of files to read concurrently")
+	dedup := runCmd.Bool("dedup", false, "Write a short reference instead of full content for files whose SHA-256 matches one already emitted")
+	incremental := runCmd.Bool("incremental", false, "Reuse byte ranges from the previous run's output for files whose size and mtime are unchanged, per the sidecar manifest")
+	shard := runCmd.Int("shard", -1, "Shard index to extract (0-based); requires -shards")
+	shards := runCmd.Int("shards", 0, "Total number of shards to split the output into, by FNV-1a hash of each file's path")
 
 	if len(os.Args) < 2 {
 		fmt.Println("Expected 'init' or 'run' subcommands")
@@ -136,6 +749,10 @@ func main() {
 		// Detect project type and generate codex.yml
 		projectType := detectProjectType(dir)
 		config := generateCodexYml(dir, projectType)
+		if patterns := importGitignore(dir); len(patterns) > 0 {
+			config.Exclude = append(config.Exclude, patterns...)
+			logMessage("INFO", fmt.Sprintf("Imported %d pattern(s) from .gitignore", len(patterns)))
+		}
 		configPath := filepath.Join(dir, "codex.yml")
 
 		err := writeConfig(configPath, config)
@@ -153,6 +770,23 @@ func main() {
 		}
 		dir := runCmd.Arg(0)
 
+		// When sharding, every shard writes to its own suffixed output file
+		// so that parallel or sequential -shard runs never clobber each
+		// other's output.
+		sharded := *shards > 0
+		if *shard >= 0 && !sharded {
+			logMessage("ERROR", "-shard requires -shards to also be set")
+			os.Exit(1)
+		}
+		if sharded && (*shard < 0 || *shard >= *shards) {
+			logMessage("ERROR", fmt.Sprintf("-shard must be in [0, %d)", *shards))
+			os.Exit(1)
+		}
+		effectiveOutputPath := *outputPath
+		if sharded {
+			effectiveOutputPath = fmt.Sprintf("%s.shard-%d-of-%d", *outputPath, *shard, *shards)
+		}
+
 		// Determine the configuration file path
 		configPath := filepath.Join(dir, "codex.yml")
 		if _, err := os.Stat(configPath); os.IsNotExist(err) {
@@ -170,8 +804,25 @@ func main() {
 			os.Exit(1)
 		}
 
+		// For -incremental, load the previous manifest and output bytes
+		// before truncating the output file below.
+		var priorByPath map[string]ManifestEntry
+		var priorOutput []byte
+		if *incremental {
+			if manifest, err := loadManifest(effectiveOutputPath); err == nil {
+				if data, err := ioutil.ReadFile(effectiveOutputPath); err == nil {
+					priorByPath = manifestByPath(manifest)
+					priorOutput = data
+				} else {
+					logMessage("INFO", "No previous output found, -incremental will do a full run")
+				}
+			} else {
+				logMessage("INFO", "No previous manifest found, -incremental will do a full run")
+			}
+		}
+
 		// Prepare the output file
-		outputFile, err := os.Create(*outputPath)
+		outputFile, err := os.Create(effectiveOutputPath)
 		if err != nil {
 			logMessage("ERROR", fmt.Sprintf("Failed to create output file: %s", err))
 			os.Exit(1)
@@ -180,48 +831,57 @@ func main() {
 
 		writer := bufio.NewWriter(outputFile)
 
-		// Traverse the directory structure and process files
-		err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				logMessage("ERROR", fmt.Sprintf("Error accessing path %s: %s", path, err))
-				return err
-			}
-
-			// Check if the current file or folder should be excluded
-			if info.IsDir() && shouldExclude(path, config.ExcludeFolders) {
-				logMessage("INFO", fmt.Sprintf("Skipping folder: %s", path))
-				return filepath.SkipDir
-			}
-			if !info.IsDir() && shouldExclude(info.Name(), config.ExcludeFiles) {
-				logMessage("INFO", fmt.Sprintf("Skipping file: %s", path))
-				return nil
-			}
-
-			// Process files
-			if !info.IsDir() {
-				logMessage("INFO", fmt.Sprintf("Processing file: %s", path))
-				writer.WriteString(fmt.Sprintf("##### %s #####\n\n", path))
+		// Walk the directory structure once to build the file list, then
+		// read and hash each file through a bounded worker pool. Chunks are
+		// assembled and flushed in walk order so the output stays
+		// byte-identical to a serial run regardless of how the reads were
+		// scheduled.
+		files, err := collectFiles(dir, config)
+		if err != nil {
+			logMessage("ERROR", fmt.Sprintf("Error walking the path: %s", err))
+			os.Exit(1)
+		}
 
-				content, err := ioutil.ReadFile(path)
-				if err != nil {
-					logMessage("ERROR", fmt.Sprintf("Failed to read file: %s", err))
-					return err
-				}
-				writer.Write(content)
-				writer.WriteString("\n\n")
-			}
+		if sharded {
+			files = filterShard(files, *shard, *shards)
+			logMessage("INFO", fmt.Sprintf("Shard %d/%d selected %d file(s)", *shard, *shards, len(files)))
+		}
 
-			return nil
-		})
+		results, err := processFilesParallel(files, *jobs, priorByPath)
+		if err != nil {
+			logMessage("ERROR", fmt.Sprintf("Error processing files: %s", err))
+			os.Exit(1)
+		}
 
+		manifest, err := assembleOutput(writer, results, priorOutput, priorByPath, *dedup)
 		if err != nil {
-			logMessage("ERROR", fmt.Sprintf("Error walking the path: %s", err))
+			logMessage("ERROR", fmt.Sprintf("Error assembling output: %s", err))
 			os.Exit(1)
 		}
 
 		// Ensure all buffered data is written to the file
 		writer.Flush()
-		logMessage("INFO", fmt.Sprintf("All code has been extracted to %s", *outputPath))
+
+		if err := writeManifest(effectiveOutputPath, manifest); err != nil {
+			logMessage("ERROR", fmt.Sprintf("Failed to write manifest: %s", err))
+			os.Exit(1)
+		}
+
+		if sharded {
+			idx := loadShardIndex(effectiveOutputPath, *shards)
+			paths := make([]string, len(files))
+			for i, f := range files {
+				paths[i] = f.path
+			}
+			idx.Shards = *shards
+			idx.Assignments[fmt.Sprintf("%d", *shard)] = paths
+			if err := writeShardIndex(effectiveOutputPath, idx); err != nil {
+				logMessage("ERROR", fmt.Sprintf("Failed to write shard index: %s", err))
+				os.Exit(1)
+			}
+		}
+
+		logMessage("INFO", fmt.Sprintf("All code has been extracted to %s", effectiveOutputPath))
 
 	default:
 		fmt.Println("Expected 'init' or 'run' subcommands")
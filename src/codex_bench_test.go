@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// synthesizeTree writes fileCount files of fileSize bytes under dir and
+// returns them as fileEntry values, ready for processFilesParallel.
+func synthesizeTree(tb testing.TB, dir string, fileCount, fileSize int) []fileEntry {
+	tb.Helper()
+
+	content := bytes.Repeat([]byte("a"), fileSize)
+	entries := make([]fileEntry, 0, fileCount)
+	for i := 0; i < fileCount; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("file_%04d.txt", i))
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			tb.Fatalf("failed to write synthetic file: %s", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			tb.Fatalf("failed to stat synthetic file: %s", err)
+		}
+		entries = append(entries, fileEntry{path: path, info: info})
+	}
+	return entries
+}
+
+// BenchmarkProcessFilesParallelJobs measures the speedup -n gives on a
+// synthetic tree by comparing a single worker against runtime.NumCPU().
+func BenchmarkProcessFilesParallelJobs(b *testing.B) {
+	dir := b.TempDir()
+	files := synthesizeTree(b, dir, 500, 4096)
+
+	jobCounts := []int{1, runtime.NumCPU()}
+	for _, jobs := range jobCounts {
+		jobs := jobs
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := processFilesParallel(files, jobs, nil); err != nil {
+					b.Fatalf("processFilesParallel failed: %s", err)
+				}
+			}
+		})
+	}
+}
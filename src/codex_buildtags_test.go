@@ -0,0 +1,75 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchesFilenameConstraints(t *testing.T) {
+	cases := []struct {
+		name   string
+		file   string
+		config Config
+		want   bool
+	}{
+		{"GOOS suffix matches", "foo_linux.go", Config{GOOS: "linux"}, true},
+		{"GOOS suffix mismatches", "foo_linux.go", Config{GOOS: "darwin"}, false},
+		{"GOARCH test suffix matches", "foo_amd64_test.go", Config{GOARCH: "amd64"}, true},
+		{"GOARCH test suffix mismatches", "foo_amd64_test.go", Config{GOARCH: "arm64"}, false},
+		{"combined GOOS_GOARCH matches both", "foo_linux_amd64.go", Config{GOOS: "linux", GOARCH: "amd64"}, true},
+		{"combined GOOS_GOARCH mismatches GOOS", "foo_linux_amd64.go", Config{GOOS: "windows", GOARCH: "amd64"}, false},
+		{"combined GOOS_GOARCH mismatches GOARCH", "foo_linux_amd64.go", Config{GOOS: "linux", GOARCH: "arm64"}, false},
+		{"plain file always matches", "foo.go", Config{GOOS: "linux"}, true},
+		{"non-os/arch underscore segment ignored", "foo_helper.go", Config{GOOS: "linux"}, true},
+		{"unconfigured GOOS accepts any suffix", "foo_windows.go", Config{}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := matchesFilenameConstraints(tc.file, tc.config)
+			if got != tc.want {
+				t.Errorf("matchesFilenameConstraints(%q, %+v) = %v, want %v", tc.file, tc.config, got, tc.want)
+			}
+		})
+	}
+}
+
+func writeGoFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	mustWriteFile(t, path, []byte(content))
+	return path
+}
+
+func TestMatchesGoEnvironmentBuildConstraintComment(t *testing.T) {
+	dir := t.TempDir()
+	path := writeGoFile(t, dir, "constrained.go", "//go:build linux\n\npackage main\n")
+
+	if !matchesGoEnvironment(path, Config{GOOS: "linux"}) {
+		t.Error("expected file constrained to linux to match GOOS=linux")
+	}
+	if matchesGoEnvironment(path, Config{GOOS: "darwin"}) {
+		t.Error("expected file constrained to linux to not match GOOS=darwin")
+	}
+}
+
+func TestMatchesGoEnvironmentCustomBuildTag(t *testing.T) {
+	dir := t.TempDir()
+	path := writeGoFile(t, dir, "tagged.go", "//go:build experimental\n\npackage main\n")
+
+	if matchesGoEnvironment(path, Config{GOOS: "linux"}) {
+		t.Error("expected file requiring the experimental tag to be excluded without it configured")
+	}
+	if !matchesGoEnvironment(path, Config{GOOS: "linux", BuildTags: []string{"experimental"}}) {
+		t.Error("expected file requiring the experimental tag to match once it is configured")
+	}
+}
+
+func TestMatchesGoEnvironmentNoConfigIsNoOp(t *testing.T) {
+	dir := t.TempDir()
+	path := writeGoFile(t, dir, "foo_windows.go", "//go:build windows\n\npackage main\n")
+
+	if !matchesGoEnvironment(path, Config{}) {
+		t.Error("filtering should be a no-op when GOOS/GOARCH/BuildTags are all unset")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import "testing"
+
+func TestIsExcludedSubstringRegression(t *testing.T) {
+	// The original bug: a substring match on "bin" wrongly excluded
+	// "binaries/" and "mybinary.go". The gitignore-style matcher must not.
+	config := Config{ExcludeFolders: []string{"bin"}, ExcludeFiles: []string{"bin"}}
+
+	if isExcluded("binaries", true, config) {
+		t.Error(`"binaries" folder should not match exclude pattern "bin"`)
+	}
+	if isExcluded("mybinary.go", false, config) {
+		t.Error(`"mybinary.go" should not match exclude pattern "bin"`)
+	}
+	if !isExcluded("bin", true, config) {
+		t.Error(`"bin" folder should match exclude pattern "bin"`)
+	}
+}
+
+func TestGitignoreMatchAnchoring(t *testing.T) {
+	cases := []struct {
+		name    string
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"anchored matches root vendor", "/vendor", "vendor", true, true},
+		{"anchored does not match nested vendor", "/vendor", "pkg/vendor", true, false},
+		{"unanchored matches nested vendor", "vendor", "pkg/vendor", true, true},
+		{"unanchored matches root vendor", "vendor", "vendor", true, true},
+		{"star matches at root", "*.log", "debug.log", false, true},
+		{"unanchored star matches any depth", "*.log", "logs/debug.log", false, true},
+		{"double star matches any depth", "**/debug.log", "a/b/c/debug.log", false, true},
+		{"double star matches zero depth", "**/debug.log", "debug.log", false, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := gitignoreMatch(tc.pattern, tc.path, tc.isDir)
+			if got != tc.want {
+				t.Errorf("gitignoreMatch(%q, %q, %v) = %v, want %v", tc.pattern, tc.path, tc.isDir, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGitignoreMatchDirOnly(t *testing.T) {
+	if gitignoreMatch("build/", "build", false) {
+		t.Error(`"build/" should not match a file named "build"`)
+	}
+	if !gitignoreMatch("build/", "build", true) {
+		t.Error(`"build/" should match a directory named "build"`)
+	}
+}
+
+func TestIsExcludedNegationReIncludes(t *testing.T) {
+	config := Config{Exclude: []string{"*.log", "!important.log"}}
+
+	if !isExcluded("debug.log", false, config) {
+		t.Error(`"debug.log" should be excluded by "*.log"`)
+	}
+	if isExcluded("important.log", false, config) {
+		t.Error(`"!important.log" should re-include "important.log"`)
+	}
+}
+
+func TestIsExcludedIncludeOverridesExclude(t *testing.T) {
+	config := Config{
+		Exclude: []string{"*.log"},
+		Include: []string{"keep.log"},
+	}
+
+	if !isExcluded("debug.log", false, config) {
+		t.Error(`"debug.log" should still be excluded`)
+	}
+	if isExcluded("keep.log", false, config) {
+		t.Error(`Include allowlist should re-include "keep.log"`)
+	}
+}
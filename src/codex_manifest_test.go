@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustWriteFile(t *testing.T, path string, content []byte) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", path, err)
+	}
+}
+
+// TestDedupSkipsExcludedDuplicates verifies that a file excluded via
+// ExcludeFiles never enters the dedup bookkeeping, even though its content
+// (and therefore its SHA-256) is identical to an included file's.
+func TestDedupSkipsExcludedDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	shared := []byte("shared content\n")
+	mustWriteFile(t, filepath.Join(dir, "keep_a.txt"), shared)
+	mustWriteFile(t, filepath.Join(dir, "keep_b.txt"), shared)
+	mustWriteFile(t, filepath.Join(dir, "skip.log"), shared)
+
+	config := Config{ExcludeFiles: []string{"*.log"}}
+	files, err := collectFiles(dir, config)
+	if err != nil {
+		t.Fatalf("collectFiles failed: %s", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files after excluding *.log, got %d", len(files))
+	}
+	for _, f := range files {
+		if strings.HasSuffix(f.path, ".log") {
+			t.Fatalf("excluded file %s leaked into collected files", f.path)
+		}
+	}
+
+	results, err := processFilesParallel(files, 2, nil)
+	if err != nil {
+		t.Fatalf("processFilesParallel failed: %s", err)
+	}
+
+	var buf bytes.Buffer
+	writer := bufio.NewWriter(&buf)
+	manifest, err := assembleOutput(writer, results, nil, nil, true)
+	if err != nil {
+		t.Fatalf("assembleOutput failed: %s", err)
+	}
+	writer.Flush()
+
+	if len(manifest.Entries) != 2 {
+		t.Fatalf("expected 2 manifest entries, got %d", len(manifest.Entries))
+	}
+
+	var dupCount int
+	for _, entry := range manifest.Entries {
+		if entry.IsDup {
+			dupCount++
+			if entry.DupOf == "" || strings.HasSuffix(entry.DupOf, ".log") {
+				t.Fatalf("dup entry references unexpected path %q", entry.DupOf)
+			}
+		}
+	}
+	if dupCount != 1 {
+		t.Fatalf("expected exactly 1 dedup stub among included files, got %d", dupCount)
+	}
+}
+
+// TestManifestEntrySchema pins the JSON field names of ManifestEntry so a
+// later refactor can't silently rename them out from under -incremental.
+func TestManifestEntrySchema(t *testing.T) {
+	entry := ManifestEntry{
+		Path:    "a/b.go",
+		Size:    123,
+		SHA256:  "deadbeef",
+		ModTime: time.Unix(1700000000, 0).UTC(),
+		Offset:  10,
+		Length:  20,
+		IsDup:   true,
+		DupOf:   "a/first.go",
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("Unmarshal into map failed: %s", err)
+	}
+
+	for _, key := range []string{"path", "size", "sha256", "mod_time", "offset", "length", "is_dup", "dup_of"} {
+		if _, ok := raw[key]; !ok {
+			t.Errorf("manifest entry JSON missing expected key %q: %s", key, data)
+		}
+	}
+
+	var roundTripped ManifestEntry
+	if err := json.Unmarshal(data, &roundTripped); err != nil {
+		t.Fatalf("Unmarshal into ManifestEntry failed: %s", err)
+	}
+	if !roundTripped.ModTime.Equal(entry.ModTime) {
+		t.Fatalf("ModTime did not round-trip: got %v, want %v", roundTripped.ModTime, entry.ModTime)
+	}
+	roundTripped.ModTime = entry.ModTime
+	if roundTripped != entry {
+		t.Fatalf("manifest entry did not round-trip: got %+v, want %+v", roundTripped, entry)
+	}
+}
+
+// TestIncrementalDedupDoesNotReuseStaleStub runs the dedup pipeline twice
+// over the same unchanged files and checks that a dup entry is re-rendered
+// as a fresh stub on the second run instead of having its previous stub
+// bytes copied forward through -incremental reuse as if they were real
+// content (the bug fixed by readAndHashFile's prior.IsDup guard).
+func TestIncrementalDedupDoesNotReuseStaleStub(t *testing.T) {
+	dir := t.TempDir()
+	shared := []byte("shared content\n")
+	pathA := filepath.Join(dir, "a.txt")
+	pathB := filepath.Join(dir, "b.txt")
+	mustWriteFile(t, pathA, shared)
+	mustWriteFile(t, pathB, shared)
+
+	files, err := collectFiles(dir, Config{})
+	if err != nil {
+		t.Fatalf("collectFiles failed: %s", err)
+	}
+
+	firstResults, err := processFilesParallel(files, 2, nil)
+	if err != nil {
+		t.Fatalf("first processFilesParallel failed: %s", err)
+	}
+
+	var firstBuf bytes.Buffer
+	firstWriter := bufio.NewWriter(&firstBuf)
+	firstManifest, err := assembleOutput(firstWriter, firstResults, nil, nil, true)
+	if err != nil {
+		t.Fatalf("first assembleOutput failed: %s", err)
+	}
+	firstWriter.Flush()
+
+	firstByPath := manifestByPath(&firstManifest)
+	firstB, ok := firstByPath[pathB]
+	if !ok || !firstB.IsDup {
+		t.Fatalf("expected %s to be a dedup stub on the first run, got %+v", pathB, firstB)
+	}
+
+	secondResults, err := processFilesParallel(files, 2, firstByPath)
+	if err != nil {
+		t.Fatalf("second processFilesParallel failed: %s", err)
+	}
+
+	for _, r := range secondResults {
+		if r.path == pathB && r.reused {
+			t.Fatalf("%s was reused from its prior dedup stub instead of being re-read", pathB)
+		}
+	}
+
+	var secondBuf bytes.Buffer
+	secondWriter := bufio.NewWriter(&secondBuf)
+	secondManifest, err := assembleOutput(secondWriter, secondResults, firstBuf.Bytes(), firstByPath, true)
+	if err != nil {
+		t.Fatalf("second assembleOutput failed: %s", err)
+	}
+	secondWriter.Flush()
+
+	secondByPath := manifestByPath(&secondManifest)
+	secondB, ok := secondByPath[pathB]
+	if !ok {
+		t.Fatalf("missing manifest entry for %s on second run", pathB)
+	}
+	if !secondB.IsDup || secondB.DupOf != pathA {
+		t.Fatalf("expected %s to still be re-detected as a dup of %s on the second run, got %+v", pathB, pathA, secondB)
+	}
+}
+
+// TestManifestEntryOmitsDupFieldsWhenUnused guards the common non-dup case:
+// is_dup/dup_of should stay out of the JSON rather than clutter every entry.
+func TestManifestEntryOmitsDupFieldsWhenUnused(t *testing.T) {
+	entry := ManifestEntry{
+		Path:    "a.go",
+		Size:    1,
+		SHA256:  "x",
+		ModTime: time.Unix(0, 0).UTC(),
+		Offset:  0,
+		Length:  1,
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	if strings.Contains(string(data), "is_dup") || strings.Contains(string(data), "dup_of") {
+		t.Fatalf("expected is_dup/dup_of to be omitted for non-dup entries: %s", data)
+	}
+}
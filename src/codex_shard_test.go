@@ -0,0 +1,97 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFilterShardPartitionsAllFilesExactlyOnce(t *testing.T) {
+	var files []fileEntry
+	for i := 0; i < 50; i++ {
+		files = append(files, fileEntry{path: filepath.Join("pkg", "file", string(rune('a'+i)), "x.go")})
+	}
+
+	const shards = 4
+	seen := make(map[string]int)
+	for shard := 0; shard < shards; shard++ {
+		for _, f := range filterShard(files, shard, shards) {
+			seen[f.path]++
+		}
+	}
+
+	if len(seen) != len(files) {
+		t.Fatalf("expected all %d files assigned to exactly one shard, got %d distinct paths covered", len(files), len(seen))
+	}
+	for path, count := range seen {
+		if count != 1 {
+			t.Fatalf("%s was assigned to %d shards, want exactly 1", path, count)
+		}
+	}
+}
+
+func TestFilterShardIsDeterministic(t *testing.T) {
+	files := []fileEntry{{path: "a.go"}, {path: "b.go"}, {path: "c.go"}}
+
+	first := filterShard(files, 1, 3)
+	second := filterShard(files, 1, 3)
+
+	if len(first) != len(second) {
+		t.Fatalf("filterShard returned different counts across calls: %d vs %d", len(first), len(second))
+	}
+	for i := range first {
+		if first[i].path != second[i].path {
+			t.Fatalf("filterShard is not deterministic: %v vs %v", first, second)
+		}
+	}
+}
+
+func TestShardIndexAccumulatesAcrossShards(t *testing.T) {
+	dir := t.TempDir()
+	outputPath := filepath.Join(dir, "code.txt.shard-0-of-2")
+
+	idx := loadShardIndex(outputPath, 2)
+	idx.Shards = 2
+	idx.Assignments["0"] = []string{"a.go"}
+	if err := writeShardIndex(outputPath, idx); err != nil {
+		t.Fatalf("writeShardIndex failed: %s", err)
+	}
+
+	idx = loadShardIndex(outputPath, 2)
+	idx.Shards = 2
+	idx.Assignments["1"] = []string{"b.go"}
+	if err := writeShardIndex(outputPath, idx); err != nil {
+		t.Fatalf("writeShardIndex failed: %s", err)
+	}
+
+	final := loadShardIndex(outputPath, 2)
+	if len(final.Assignments["0"]) != 1 || final.Assignments["0"][0] != "a.go" {
+		t.Fatalf("expected shard 0's prior assignment to survive accumulation, got %+v", final.Assignments)
+	}
+	if len(final.Assignments["1"]) != 1 || final.Assignments["1"][0] != "b.go" {
+		t.Fatalf("expected shard 1's assignment to be recorded, got %+v", final.Assignments)
+	}
+}
+
+// TestLoadShardIndexResetsStaleAssignments covers the fix where an index
+// built under one -shards total must not leak its assignments into a run
+// under a different total, since they were computed from a different
+// hash-mod-shards split and no longer describe any shard of the new run.
+func TestLoadShardIndexResetsStaleAssignments(t *testing.T) {
+	dir := t.TempDir()
+	outputPath := filepath.Join(dir, "code.txt.shard-0-of-4")
+
+	idx := loadShardIndex(outputPath, 4)
+	idx.Shards = 4
+	idx.Assignments["0"] = []string{"a.go"}
+	idx.Assignments["1"] = []string{"b.go"}
+	idx.Assignments["2"] = []string{"c.go"}
+	idx.Assignments["3"] = []string{"d.go"}
+	if err := writeShardIndex(outputPath, idx); err != nil {
+		t.Fatalf("writeShardIndex failed: %s", err)
+	}
+
+	reloaded := loadShardIndex(outputPath, 8)
+	if len(reloaded.Assignments) != 0 {
+		t.Fatalf("expected stale 4-shard assignments to be dropped when reloading under -shards=8, got %+v", reloaded.Assignments)
+	}
+}